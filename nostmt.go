@@ -6,10 +6,19 @@ import (
 	"debug/elf"
 	"debug/macho"
 	"debug/pe"
+	"encoding/json"
+	"encoding/xml"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"html"
 	"io"
 	"os"
+	"path"
+	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"unicode"
@@ -19,23 +28,166 @@ var noshowline = flag.Bool("q", false, "does not show line contents")
 var showruntime = flag.Bool("r", false, "shows hits in runtime package")
 var bekind = flag.Bool("k", false, "suppress some false positives")
 var countonly = flag.Bool("c", false, "only show counts of total and missed")
+var objFormatFlag = flag.String("objformat", "", "force a specific object-file backend (elf, pe, macho, xcoff) instead of auto-detecting")
+var includeStdlib = flag.Bool("stdlib", true, "include standard-library compile units (those whose comp_dir is under GOROOT)")
+var reportFormat = flag.String("format", "text", "report format: text, json, sarif, or checkstyle")
+var baselineFlag = flag.String("baseline", "", "compare against this earlier binary and report only newly-lost statement lines (regressions), plus a count of recovered lines")
+var htmlFlag = flag.String("html", "", "write a self-contained HTML report with source annotation to this file")
 
-func open(path string) (*dwarf.Data, error) {
-	if fh, err := elf.Open(path); err == nil {
-		return fh.DWARF()
-	}
+// stringList collects the values of a repeatable flag, e.g. -include a -include b.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+var includePatterns stringList
+var excludePatterns stringList
+
+func init() {
+	flag.Var(&includePatterns, "include", "only show hits from compile units matching this pkgpath glob or file-path regexp (repeatable)")
+	flag.Var(&excludePatterns, "exclude", "hide hits from compile units matching this pkgpath glob or file-path regexp (repeatable)")
+}
+
+// A Backend knows how to recognize one object-file format and pull its
+// DWARF data out. open tries each registered Backend in turn; -objformat
+// picks one by Name and skips auto-detection.
+type Backend struct {
+	Name string
+	Open func(path string) (*dwarf.Data, error)
+}
 
-	if fh, err := pe.Open(path); err == nil {
+// backends is the registry of known object-file formats, tried in order
+// by open. Append to this slice (e.g. from an init func in another file)
+// to teach nostmt about additional formats such as Wasm, fat Mach-O
+// slices, or a raw .debug_line file, without editing open.
+var backends = []Backend{
+	{"elf", func(path string) (*dwarf.Data, error) {
+		fh, err := elf.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return fh.DWARF()
+	}},
+	{"pe", func(path string) (*dwarf.Data, error) {
+		fh, err := pe.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return fh.DWARF()
+	}},
+	{"macho", func(path string) (*dwarf.Data, error) {
+		fh, err := macho.Open(path)
+		if err != nil {
+			return nil, err
+		}
 		return fh.DWARF()
+	}},
+	{"xcoff", xcoffDWARF},
+}
+
+func open(path string) (*dwarf.Data, error) {
+	if *objFormatFlag != "" {
+		for _, b := range backends {
+			if b.Name == *objFormatFlag {
+				return b.Open(path)
+			}
+		}
+		return nil, fmt.Errorf("unknown -objformat %q", *objFormatFlag)
 	}
 
-	if fh, err := macho.Open(path); err == nil {
-		return fh.DWARF()
+	for _, b := range backends {
+		if dw, err := b.Open(path); err == nil {
+			return dw, nil
+		}
 	}
 
 	return nil, fmt.Errorf("unrecognized executable format")
 }
 
+// A CUFilter decides whether a compile unit's lines should be scanned at
+// all, based on -include, -exclude, -stdlib and the existing -r (runtime)
+// switch. pattern matching accepts either a pkgpath glob (as matched by
+// path.Match) or a file-path regexp; a pattern matches a CU if it matches
+// either form.
+type CUFilter struct {
+	include []string
+	exclude []string
+	goroot  string
+}
+
+func newCUFilter(include, exclude []string) *CUFilter {
+	goroot := runtime.GOROOT()
+	if g := os.Getenv("GOROOT"); g != "" {
+		goroot = g
+	}
+	return &CUFilter{include: include, exclude: exclude, goroot: goroot}
+}
+
+// matchesPattern reports whether pattern matches the compile unit, either
+// as a pkgpath glob (as matched by path.Match) or as a regexp matched
+// against pkgpath or against filename, the CU's representative source
+// file path.
+func matchesPattern(pattern, pkgpath, filename string) bool {
+	if ok, err := path.Match(pattern, pkgpath); err == nil && ok {
+		return true
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	if re.MatchString(pkgpath) {
+		return true
+	}
+	return filename != "" && re.MatchString(filename)
+}
+
+// cuFile returns a representative source file path for the compile unit
+// lrdr reads lines for, for matching file-path regexps against; CUs
+// without any line entries (e.g. empty packages) yield "".
+func cuFile(lrdr *dwarf.LineReader) string {
+	files := lrdr.Files()
+	for _, f := range files {
+		if f != nil && f.Name != "" {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+// Allow reports whether lines from the compile unit named pkgpath, whose
+// DWARF comp_dir is compDir and representative source file is filename,
+// should be scanned.
+func (f *CUFilter) Allow(pkgpath, compDir, filename string) bool {
+	if pkgpath == "runtime" && !*showruntime {
+		return false
+	}
+	if !*includeStdlib && f.goroot != "" && strings.HasPrefix(compDir, f.goroot) {
+		return false
+	}
+	if len(f.include) > 0 {
+		matched := false
+		for _, p := range f.include {
+			if matchesPattern(p, pkgpath, filename) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, p := range f.exclude {
+		if matchesPattern(p, pkgpath, filename) {
+			return false
+		}
+	}
+	return true
+}
+
 func must(err error) {
 	if err != nil {
 		panic(err)
@@ -47,72 +199,430 @@ type Line struct {
 	Line int
 }
 
-func display(line Line) int {
-	var ok bool
-	var t string
-	var file *File
-	if !*noshowline || *bekind {
-		file = loadFile(line.File)
-		t, ok = file.Get(line.Line)
+// lineMeta carries the DWARF context for a Line that display formats
+// beyond plain text need: which package it came from and a representative
+// program counter.
+type lineMeta struct {
+	Package string
+	PC      uint64
+}
+
+// Hit is one non-stmt line, with enough context for any Reporter to
+// render it.
+type Hit struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Text    string `json:"text,omitempty"`
+	Package string `json:"package"`
+	PC      uint64 `json:"pc"`
+}
+
+// buildHits turns the raw non-stmt lines into Hits, dropping any that
+// -k recognizes as false positives and filling in source text and
+// package/pc metadata from meta.
+func buildHits(nonStmtLines []Line, meta map[Line]lineMeta) []Hit {
+	hits := make([]Hit, 0, len(nonStmtLines))
+	for _, line := range nonStmtLines {
+		if *bekind && suppress(line.File, line.Line) {
+			continue
+		}
+		t, _ := loadFile(line.File).Get(line.Line)
+		m := meta[line]
+		hits = append(hits, Hit{
+			File:    line.File,
+			Line:    line.Line,
+			Text:    t,
+			Package: m.Package,
+			PC:      m.PC,
+		})
 	}
-	if *bekind && suppress(file, line.Line) {
-		return 0
+	return hits
+}
+
+// Summary carries the whole-run counters a Reporter prints alongside its
+// per-hit output: Total is the number of DWARF-mapped lines scanned.
+// Recovered is only meaningful for -baseline diff mode (the count of
+// lines that gained IsStmt relative to the baseline); it is negative
+// when there is no baseline to compare against.
+type Summary struct {
+	Total     int
+	Recovered int
+}
+
+// A Reporter renders a slice of Hits, plus a run Summary, in some output
+// format. -c (counts only) is a property of the text reporter rather
+// than a global branch, so other reporters always emit full results.
+type Reporter interface {
+	Report(hits []Hit, summary Summary) error
+}
+
+// textReporter reproduces nostmt's original human-readable output.
+type textReporter struct {
+	ShowLine  bool
+	CountOnly bool
+}
+
+func (r *textReporter) Report(hits []Hit, summary Summary) error {
+	count := 0
+	for _, h := range hits {
+		count++
+		if r.CountOnly {
+			continue
+		}
+		if !r.ShowLine || h.Text == "" {
+			fmt.Printf("%s:%d\n", h.File, h.Line)
+			continue
+		}
+		fmt.Printf("%s:%d: %s\n", h.File, h.Line, h.Text)
 	}
-	if *countonly {
-		return 1
+	if r.CountOnly {
+		fmt.Printf("total=%d, nostmt=%d\n", summary.Total, count)
 	}
-	if !ok || *noshowline {
-		fmt.Printf("%s:%d\n", line.File, line.Line)
-		return 1
+	if summary.Recovered >= 0 {
+		fmt.Printf("recovered=%d\n", summary.Recovered)
 	}
-	fmt.Printf("%s:%d: %s\n", line.File, line.Line, t)
-	return 1
+	return nil
 }
 
-func suppress(file *File, lineno int) bool {
-	// this assumes go formatted code
+// jsonReporter streams one JSON object per hit, one per line, followed
+// by a trailing {"recovered":N} line when summary.Recovered applies.
+type jsonReporter struct{}
 
-	line, _ := file.Get(lineno)
-	line = strings.TrimSpace(line)
+type jsonSummary struct {
+	Recovered int `json:"recovered"`
+}
 
-	// suppress empty lines, just so I don't have to worry about empty lines in the following
-	if line == "" {
-		return true
+func (r *jsonReporter) Report(hits []Hit, summary Summary) error {
+	enc := json.NewEncoder(os.Stdout)
+	for _, h := range hits {
+		if err := enc.Encode(h); err != nil {
+			return err
+		}
+	}
+	if summary.Recovered >= 0 {
+		return enc.Encode(jsonSummary{Recovered: summary.Recovered})
 	}
+	return nil
+}
 
-	// suppress lines that have nothing but symbols in them
-	onlysyms := true
-	for _, ch := range line {
-		if unicode.IsLetter(ch) || unicode.IsNumber(ch) {
-			onlysyms = false
-			break
+// sarifReporter emits a single SARIF log with one result per hit, for
+// upload to GitHub code scanning or Sonar.
+type sarifReporter struct{}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool        `json:"tool"`
+	Results    []sarifResult    `json:"results"`
+	Properties *sarifProperties `json:"properties,omitempty"`
+}
+
+// sarifProperties carries nostmt-specific data that has no dedicated
+// SARIF field, via SARIF's generic properties bag.
+type sarifProperties struct {
+	Recovered int `json:"recovered"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+const sarifRuleID = "go-nostmt"
+
+func (r *sarifReporter) Report(hits []Hit, summary Summary) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:  "nostmt",
+			Rules: []sarifRule{{ID: sarifRuleID}},
+		}},
+		Results: make([]sarifResult, 0, len(hits)),
+	}
+	if summary.Recovered >= 0 {
+		run.Properties = &sarifProperties{Recovered: summary.Recovered}
+	}
+	log := sarifLog{
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	for _, h := range hits {
+		log.Runs[0].Results = append(log.Runs[0].Results, sarifResult{
+			RuleID:  sarifRuleID,
+			Level:   "warning",
+			Message: sarifMessage{Text: fmt.Sprintf("line not marked is_stmt: %s", h.Text)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: h.File},
+				Region:           sarifRegion{StartLine: h.Line},
+			}}},
+		})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// checkstyleReporter emits Checkstyle-compatible XML, grouped by file,
+// for CI systems that consume that format.
+type checkstyleReporter struct{}
+
+type checkstyleRoot struct {
+	XMLName   xml.Name         `xml:"checkstyle"`
+	Version   string           `xml:"version,attr"`
+	Recovered *int             `xml:"recovered,attr,omitempty"`
+	Files     []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string           `xml:"name,attr"`
+	Errors []checkstyleItem `xml:"error"`
+}
+
+type checkstyleItem struct {
+	Line     int    `xml:"line,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+func (r *checkstyleReporter) Report(hits []Hit, summary Summary) error {
+	var order []string
+	byFile := map[string][]checkstyleItem{}
+	for _, h := range hits {
+		if _, ok := byFile[h.File]; !ok {
+			order = append(order, h.File)
 		}
+		byFile[h.File] = append(byFile[h.File], checkstyleItem{
+			Line:     h.Line,
+			Severity: "warning",
+			Message:  fmt.Sprintf("line not marked is_stmt: %s", h.Text),
+			Source:   sarifRuleID,
+		})
 	}
-	if onlysyms {
-		return true
+	files := make([]checkstyleFile, 0, len(order))
+	for _, name := range order {
+		files = append(files, checkstyleFile{Name: name, Errors: byFile[name]})
+	}
+	root := checkstyleRoot{Version: "4.3", Files: files}
+	if summary.Recovered >= 0 {
+		root.Recovered = &summary.Recovered
 	}
+	out, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(xml.Header + string(out))
+	return nil
+}
 
-	// suppress function headings
-	if strings.HasPrefix(line, "func ") {
-		return true
+func newReporter(format string) (Reporter, error) {
+	switch format {
+	case "", "text":
+		return &textReporter{ShowLine: !*noshowline, CountOnly: *countonly}, nil
+	case "json":
+		return &jsonReporter{}, nil
+	case "sarif":
+		return &sarifReporter{}, nil
+	case "checkstyle":
+		return &checkstyleReporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown -format %q", format)
+	}
+}
+
+// astFile holds a parsed source file and the set of lines within it that
+// the suppress classifier has decided are never genuine statements.
+type astFile struct {
+	fset     *token.FileSet
+	file     *ast.File // nil if the file failed to parse
+	suppress map[int]bool
+}
+
+var astCache = map[string]*astFile{}
+
+// loadAST parses filename once and caches the result alongside fileCache.
+// Parse failures (non-Go files, syntax errors in vendored/generated code,
+// etc.) are cached too, as a nil *ast.File, so for such a file suppress
+// only hides empty and punctuation-only lines.
+func loadAST(filename string) *astFile {
+	if a, ok := astCache[filename]; ok {
+		return a
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	a := &astFile{fset: fset}
+	if err == nil {
+		a.file = f
+		a.suppress = classifySuppressedLines(fset, f)
+	}
+	astCache[filename] = a
+	return a
+}
+
+// markLines marks every line spanned by [from, to] as suppressed.
+func markLines(suppress map[int]bool, fset *token.FileSet, from, to token.Pos) {
+	start := fset.Position(from).Line
+	end := fset.Position(to).Line
+	for l := start; l <= end; l++ {
+		suppress[l] = true
 	}
+}
+
+// classifySuppressedLines walks f and marks the lines that only ever
+// cover syntax that can't be a real statement: a FuncDecl's signature (as
+// opposed to its body), a CaseClause/CommClause header up to its colon,
+// a var/const ValueSpec with no initializer, an import declaration,
+// struct/interface field declarations of a named type, and the header of
+// a for/switch/type switch that has no init statement (and, for for and
+// switch, no condition, post statement or tag).
+func classifySuppressedLines(fset *token.FileSet, f *ast.File) map[int]bool {
+	suppress := map[int]bool{}
 
-	// suppress clauseless for and switch headings
-	if line == "for {" || line == "switch {" {
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch d := n.(type) {
+		case *ast.FuncDecl:
+			end := d.Type.End()
+			if d.Body != nil {
+				end = d.Body.Lbrace
+			}
+			markLines(suppress, fset, d.Pos(), end)
+		case *ast.GenDecl:
+			switch d.Tok {
+			case token.IMPORT:
+				markLines(suppress, fset, d.Pos(), d.End())
+			case token.VAR, token.CONST:
+				for _, spec := range d.Specs {
+					vs, ok := spec.(*ast.ValueSpec)
+					if ok && len(vs.Values) == 0 {
+						markLines(suppress, fset, vs.Pos(), vs.End())
+					}
+				}
+			case token.TYPE:
+				for _, spec := range d.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					var fields *ast.FieldList
+					switch t := ts.Type.(type) {
+					case *ast.StructType:
+						fields = t.Fields
+					case *ast.InterfaceType:
+						fields = t.Methods
+					}
+					if fields == nil {
+						continue
+					}
+					for _, field := range fields.List {
+						markLines(suppress, fset, field.Pos(), field.End())
+					}
+				}
+			}
+		}
 		return true
+	})
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch c := n.(type) {
+		case *ast.CaseClause:
+			markLines(suppress, fset, c.Pos(), c.Colon)
+		case *ast.CommClause:
+			markLines(suppress, fset, c.Pos(), c.Colon)
+		case *ast.ForStmt:
+			// Only a bare "for {" is never a statement; "for i := 0; ...;
+			// i++ {" carries real init/cond/post statements that DWARF can
+			// legitimately mark IsStmt.
+			if c.Body != nil && c.Init == nil && c.Cond == nil && c.Post == nil {
+				markLines(suppress, fset, c.Pos(), c.Body.Lbrace)
+			}
+		case *ast.SwitchStmt:
+			// Only a bare "switch {"; "switch y := x[0]; y {" has a real
+			// init statement and/or tag expression.
+			if c.Body != nil && c.Init == nil && c.Tag == nil {
+				markLines(suppress, fset, c.Pos(), c.Body.Lbrace)
+			}
+		case *ast.TypeSwitchStmt:
+			// The Assign clause ("x := v.(type)" or "v.(type)") is mandatory
+			// syntax, not an extra statement; only suppress when there's no
+			// separate init statement ahead of it.
+			if c.Body != nil && c.Init == nil {
+				markLines(suppress, fset, c.Pos(), c.Body.Lbrace)
+			}
+		}
+		return true
+	})
+
+	return suppress
+}
+
+// suppress reports whether lineno in filename should be hidden as a
+// false positive: an empty or punctuation-only line, or a line the AST
+// classifier has identified as syntax that can never be a real
+// statement (see classifySuppressedLines).
+func suppress(filename string, lineno int) bool {
+	file := loadFile(filename)
+	line, ok := file.Get(lineno)
+	if !ok {
+		return false
 	}
+	line = strings.TrimSpace(line)
 
-	// suppress switch clauses
-	if line == "default:" || (strings.HasPrefix(line, "case ") && line[len(line)-1] == ':') {
+	if line == "" {
 		return true
 	}
 
-	// suppress variable declarations without initialization
-	if strings.HasPrefix(line, "var ") && !strings.Contains(line, "=") {
+	onlysyms := true
+	for _, ch := range line {
+		if unicode.IsLetter(ch) || unicode.IsNumber(ch) {
+			onlysyms = false
+			break
+		}
+	}
+	if onlysyms {
 		return true
 	}
 
-	return false
+	return loadAST(filename).suppress[lineno]
 }
 
 type File struct {
@@ -156,11 +666,24 @@ func (f *File) Get(lineno int) (string, bool) {
 	return f.lines[lineno-1], true
 }
 
-func main() {
-	flag.Parse()
+// Scan opens path and returns, for every Line the DWARF line tables
+// mention (subject to the -include/-exclude/-stdlib/-r compile-unit
+// filters), whether that line is ever marked IsStmt.
+func Scan(path string) (map[Line]bool, error) {
+	lines, _, err := scanMeta(path)
+	return lines, err
+}
+
+// scanMeta is Scan plus the per-line package/pc metadata that the
+// richer report formats want; Scan is the exported subset of this.
+func scanMeta(path string) (map[Line]bool, map[Line]lineMeta, error) {
+	cuFilter := newCUFilter(includePatterns, excludePatterns)
+	dw, err := open(path)
+	if err != nil {
+		return nil, nil, err
+	}
 	lines := map[Line]bool{}
-	dw, err := open(flag.Args()[0])
-	must(err)
+	meta := map[Line]lineMeta{}
 	rdr := dw.Reader()
 	rdr.Seek(0)
 	for {
@@ -173,14 +696,14 @@ func main() {
 			continue
 		}
 		pkgname, _ := e.Val(dwarf.AttrName).(string)
-		if pkgname == "runtime" {
-			if !*showruntime {
-				continue
-			}
-		}
+		compDir, _ := e.Val(dwarf.AttrCompDir).(string)
 		lrdr, err := dw.LineReader(e)
 		must(err)
 
+		if !cuFilter.Allow(pkgname, compDir, cuFile(lrdr)) {
+			continue
+		}
+
 		var le dwarf.LineEntry
 
 		for {
@@ -191,26 +714,249 @@ func main() {
 			must(err)
 			fl := Line{le.File.Name, le.Line}
 			lines[fl] = lines[fl] || le.IsStmt
+			if _, ok := meta[fl]; !ok {
+				meta[fl] = lineMeta{Package: pkgname, PC: le.Address}
+			}
 		}
 	}
+	return lines, meta, nil
+}
 
-	nonStmtLines := []Line{}
-	for line, isstmt := range lines {
-		if !isstmt {
-			nonStmtLines = append(nonStmtLines, line)
+// diffLines compares a baseline and a new Scan result over their combined
+// set of lines and reports the regressions (lines IsStmt in base but not
+// in new, including lines dropped entirely from new) plus a count of
+// recovered lines (the reverse: not IsStmt, or absent, in base but IsStmt
+// in new -- this also counts brand-new statement lines that have no
+// baseline entry at all, since from the baseline's perspective those are
+// indistinguishable from a line recovering from false to true).
+func diffLines(baseLines, newLines map[Line]bool) (regressions []Line, recovered int) {
+	seen := map[Line]bool{}
+	for l := range baseLines {
+		seen[l] = true
+	}
+	for l := range newLines {
+		seen[l] = true
+	}
+
+	for l := range seen {
+		wasStmt := baseLines[l]
+		isStmt := newLines[l]
+		switch {
+		case wasStmt && !isStmt:
+			regressions = append(regressions, l)
+		case !wasStmt && isStmt:
+			recovered++
 		}
 	}
-	sort.Slice(nonStmtLines, func(i, j int) bool {
-		if nonStmtLines[i].File == nonStmtLines[j].File {
-			return nonStmtLines[i].Line < nonStmtLines[j].Line
+	return regressions, recovered
+}
+
+func sortedLines(ls []Line) []Line {
+	sort.Slice(ls, func(i, j int) bool {
+		if ls[i].File == ls[j].File {
+			return ls[i].Line < ls[j].Line
 		}
-		return nonStmtLines[i].File < nonStmtLines[j].File
+		return ls[i].File < ls[j].File
 	})
-	count := 0
-	for _, line := range nonStmtLines {
-		count += display(line)
+	return ls
+}
+
+// runDiff implements -baseline: it scans both binaries and reports only
+// the lines that regressed from IsStmt in the baseline to not-IsStmt (or
+// gone) in path, which is the case a compiler developer bisecting a
+// missing is_stmt marker cares about. If htmlOut is non-empty, it also
+// writes an HTML report (as in non-diff mode) covering path, so -html
+// and -baseline compose instead of -html being silently dropped.
+func runDiff(baselinePath, path string, reporter Reporter, htmlOut string) {
+	baseLines, baseMeta, err := scanMeta(baselinePath)
+	must(err)
+	newLines, newMeta, err := scanMeta(path)
+	must(err)
+
+	meta := map[Line]lineMeta{}
+	for l, m := range baseMeta {
+		meta[l] = m
+	}
+	for l, m := range newMeta {
+		meta[l] = m
+	}
+
+	regressions, recovered := diffLines(baseLines, newLines)
+
+	hits := buildHits(sortedLines(regressions), meta)
+	must(reporter.Report(hits, Summary{Total: len(newLines), Recovered: recovered}))
+
+	if htmlOut != "" {
+		must(writeHTML(htmlOut, buildReport(newLines, newMeta)))
+	}
+}
+
+// Report is the data model the HTML renderer (and potentially other
+// coverage-style consumers) builds its output from: one FileReport per
+// source file that had any DWARF-mapped lines.
+type Report struct {
+	Files map[string]*FileReport
+}
+
+// FileReport is one file's worth of line coloring plus its nostmt/total
+// counters: Total is the number of DWARF-mapped lines in the file,
+// NoStmt is how many of those are not marked IsStmt (after -k
+// suppression). Stmt holds, for each mapped line number, whether it is a
+// statement (true, rendered green) or not (false, rendered red); a line
+// absent from Stmt is unmapped (rendered grey).
+type FileReport struct {
+	Name    string
+	Package string
+	Stmt    map[int]bool
+	Total   int
+	NoStmt  int
+}
+
+// buildReport turns a Scan's raw output into the per-file/per-package
+// model the HTML report renders, respecting -k the same way buildHits
+// does.
+func buildReport(lines map[Line]bool, meta map[Line]lineMeta) *Report {
+	report := &Report{Files: map[string]*FileReport{}}
+	for l, isstmt := range lines {
+		fr := report.Files[l.File]
+		if fr == nil {
+			fr = &FileReport{Name: l.File, Package: meta[l].Package, Stmt: map[int]bool{}}
+			report.Files[l.File] = fr
+		}
+		if *bekind && suppress(l.File, l.Line) {
+			isstmt = true
+		}
+		fr.Total++
+		if !isstmt {
+			fr.NoStmt++
+		}
+		fr.Stmt[l.Line] = isstmt
+	}
+	return report
+}
+
+// packageTotals aggregates FileReport counters by package, for the
+// per-package nostmt/total counters in the HTML report.
+func packageTotals(report *Report) map[string][2]int {
+	totals := map[string][2]int{}
+	for _, fr := range report.Files {
+		t := totals[fr.Package]
+		t[0] += fr.NoStmt
+		t[1] += fr.Total
+		totals[fr.Package] = t
+	}
+	return totals
+}
+
+// writeHTML renders report as a single self-contained HTML file: a
+// per-package counter table and a flat, sorted list of file links down
+// the left (files are not nested by directory), and the annotated source
+// of each file on the right, in the spirit of `go tool cover -html`.
+func writeHTML(outfile string, report *Report) error {
+	names := make([]string, 0, len(report.Files))
+	for name := range report.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out, err := os.Create(outfile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+
+	fmt.Fprint(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>nostmt report</title><style>
+body { display: flex; font-family: sans-serif; margin: 0; }
+nav { width: 28em; overflow-y: auto; height: 100vh; border-right: 1px solid #ccc; padding: 0.5em; box-sizing: border-box; }
+nav a { display: block; white-space: nowrap; text-decoration: none; color: #333; }
+nav a:hover { text-decoration: underline; }
+main { flex: 1; overflow-y: auto; height: 100vh; padding: 0.5em 1em; }
+table.counts { border-collapse: collapse; margin-bottom: 1em; }
+table.counts td, table.counts th { padding: 0.1em 0.5em; text-align: right; }
+table.counts td:first-child, table.counts th:first-child { text-align: left; }
+pre.src { margin: 0 0 2em 0; }
+pre.src div { padding: 0 0.3em; }
+.stmt { background: #d4f8d4; }
+.nostmt { background: #f8d4d4; }
+.unmapped { color: #999; }
+</style></head><body>
+<nav><h3>Packages</h3><table class="counts"><tr><th>package</th><th>nostmt</th><th>total</th></tr>`)
+
+	pkgTotals := packageTotals(report)
+	pkgNames := make([]string, 0, len(pkgTotals))
+	for name := range pkgTotals {
+		pkgNames = append(pkgNames, name)
+	}
+	sort.Strings(pkgNames)
+	for _, name := range pkgNames {
+		t := pkgTotals[name]
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%d</td><td>%d</td></tr>\n", html.EscapeString(name), t[0], t[1])
+	}
+	fmt.Fprint(w, "</table><h3>Files</h3>")
+	for _, name := range names {
+		fr := report.Files[name]
+		fmt.Fprintf(w, "<a href=\"#%s\">%s</a> (%d/%d)<br>\n", html.EscapeString(fileAnchor(name)), html.EscapeString(name), fr.NoStmt, fr.Total)
+	}
+	fmt.Fprint(w, "</nav><main>\n")
+
+	for _, name := range names {
+		fr := report.Files[name]
+		fmt.Fprintf(w, "<h3 id=\"%s\">%s</h3>\n", html.EscapeString(fileAnchor(name)), html.EscapeString(name))
+		fmt.Fprint(w, "<pre class=\"src\">\n")
+		file := loadFile(name)
+		if file != nil {
+			for i, text := range file.lines {
+				lineno := i + 1
+				class := "unmapped"
+				if isstmt, ok := fr.Stmt[lineno]; ok {
+					if isstmt {
+						class = "stmt"
+					} else {
+						class = "nostmt"
+					}
+				}
+				fmt.Fprintf(w, "<div id=\"%s\" class=\"%s\">%4d %s</div>\n", html.EscapeString(fileAnchor(name))+fmt.Sprintf("-%d", lineno), class, lineno, html.EscapeString(text))
+			}
+		}
+		fmt.Fprint(w, "</pre>\n")
 	}
-	if *countonly {
-		fmt.Printf("total=%d, nostmt=%d\n", len(lines), count)
+
+	fmt.Fprint(w, "</main></body></html>\n")
+	return w.Flush()
+}
+
+// fileAnchor turns a source path into something safe to use as an HTML
+// id/fragment.
+func fileAnchor(name string) string {
+	r := strings.NewReplacer("/", "_", ".", "_", " ", "_")
+	return "f_" + r.Replace(name)
+}
+
+func main() {
+	flag.Parse()
+	reporter, err := newReporter(*reportFormat)
+	must(err)
+
+	if *baselineFlag != "" {
+		runDiff(*baselineFlag, flag.Args()[0], reporter, *htmlFlag)
+		return
+	}
+
+	lines, meta, err := scanMeta(flag.Args()[0])
+	must(err)
+
+	if *htmlFlag != "" {
+		must(writeHTML(*htmlFlag, buildReport(lines, meta)))
+	}
+
+	nonStmtLines := []Line{}
+	for line, isstmt := range lines {
+		if !isstmt {
+			nonStmtLines = append(nonStmtLines, line)
+		}
 	}
+	hits := buildHits(sortedLines(nonStmtLines), meta)
+	must(reporter.Report(hits, Summary{Total: len(lines), Recovered: -1}))
 }
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout runs fn with os.Stdout redirected to a pipe and returns
+// everything it wrote.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = saved }()
+
+	fn()
+
+	w.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestMatchesPattern(t *testing.T) {
+	cases := []struct {
+		name                       string
+		pattern, pkgpath, filename string
+		want                       bool
+	}{
+		{"exact pkgpath", "fmt", "fmt", "/usr/local/go/src/fmt/print.go", true},
+		{"pkgpath glob", "encoding/*", "encoding/json", "/usr/local/go/src/encoding/json/decode.go", true},
+		{"pkgpath glob no match", "encoding/*", "fmt", "/usr/local/go/src/fmt/print.go", false},
+		{"file-path regexp", `.*_generated\.go$`, "myapp/gen", "/src/myapp/gen/types_generated.go", true},
+		{"file-path regexp no match", `.*_generated\.go$`, "myapp/gen", "/src/myapp/gen/types.go", false},
+		{"regexp matches pkgpath not filename", "^enc.*", "encoding/json", "/src/encoding/json/decode.go", true},
+		{"invalid regexp, no glob match", "[", "fmt", "/usr/local/go/src/fmt/print.go", false},
+		{"empty filename, regexp only matches pkgpath", "^fmt$", "fmt", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := matchesPattern(c.pattern, c.pkgpath, c.filename)
+			if got != c.want {
+				t.Errorf("matchesPattern(%q, %q, %q) = %v, want %v", c.pattern, c.pkgpath, c.filename, got, c.want)
+			}
+		})
+	}
+}
+
+func TestCUFilterAllow(t *testing.T) {
+	savedRuntime, savedStdlib := *showruntime, *includeStdlib
+	defer func() { *showruntime, *includeStdlib = savedRuntime, savedStdlib }()
+
+	cases := []struct {
+		name                       string
+		filter                     *CUFilter
+		showRuntime                bool
+		includeStdlib              bool
+		pkgpath, compDir, filename string
+		want                       bool
+	}{
+		{
+			name:    "no filters, allowed by default",
+			filter:  &CUFilter{goroot: "/usr/local/go"},
+			pkgpath: "myapp", compDir: "/home/me/myapp", filename: "/home/me/myapp/main.go",
+			includeStdlib: true,
+			want:          true,
+		},
+		{
+			name:    "runtime hidden without -r",
+			filter:  &CUFilter{goroot: "/usr/local/go"},
+			pkgpath: "runtime", compDir: "/usr/local/go/src/runtime",
+			includeStdlib: true,
+			want:          false,
+		},
+		{
+			name:        "runtime shown with -r",
+			filter:      &CUFilter{goroot: "/usr/local/go"},
+			showRuntime: true,
+			pkgpath:     "runtime", compDir: "/usr/local/go/src/runtime",
+			includeStdlib: true,
+			want:          true,
+		},
+		{
+			name:    "stdlib hidden without -stdlib",
+			filter:  &CUFilter{goroot: "/usr/local/go"},
+			pkgpath: "fmt", compDir: "/usr/local/go/src/fmt",
+			includeStdlib: false,
+			want:          false,
+		},
+		{
+			name:    "non-stdlib still shown without -stdlib",
+			filter:  &CUFilter{goroot: "/usr/local/go"},
+			pkgpath: "myapp", compDir: "/home/me/myapp",
+			includeStdlib: false,
+			want:          true,
+		},
+		{
+			name:    "include filters out non-matching pkgpath",
+			filter:  &CUFilter{include: []string{"myapp/*"}, goroot: "/usr/local/go"},
+			pkgpath: "otherapp", compDir: "/home/me/otherapp",
+			includeStdlib: true,
+			want:          false,
+		},
+		{
+			name:    "include allows matching pkgpath",
+			filter:  &CUFilter{include: []string{"myapp/*"}, goroot: "/usr/local/go"},
+			pkgpath: "myapp/sub", compDir: "/home/me/myapp/sub",
+			includeStdlib: true,
+			want:          true,
+		},
+		{
+			name:    "include allows matching file-path regexp",
+			filter:  &CUFilter{include: []string{`.*/gen/.*\.go$`}, goroot: "/usr/local/go"},
+			pkgpath: "myapp/gen", compDir: "/home/me/myapp/gen", filename: "/home/me/myapp/gen/types.go",
+			includeStdlib: true,
+			want:          true,
+		},
+		{
+			name:    "exclude hides matching pkgpath even if included",
+			filter:  &CUFilter{include: []string{"myapp/*"}, exclude: []string{"myapp/internal"}, goroot: "/usr/local/go"},
+			pkgpath: "myapp/internal", compDir: "/home/me/myapp/internal",
+			includeStdlib: true,
+			want:          false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			*showruntime, *includeStdlib = c.showRuntime, c.includeStdlib
+			got := c.filter.Allow(c.pkgpath, c.compDir, c.filename)
+			if got != c.want {
+				t.Errorf("Allow(%q, %q, %q) = %v, want %v", c.pkgpath, c.compDir, c.filename, got, c.want)
+			}
+		})
+	}
+}
+
+func TestClassifySuppressedLinesForSwitch(t *testing.T) {
+	const src = `package p
+
+func F(x []int, n int) {
+	for {
+		break
+	}
+	switch {
+	case true:
+		_ = 1
+	}
+	for i := 0; i < n; i++ {
+		_ = i
+	}
+	switch y := x[0]; y {
+	case 1:
+		_ = y
+	}
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suppress := classifySuppressedLines(fset, f)
+
+	// Bare "for {" / "switch {" headers, and case clauses, carry no real
+	// statement and should be suppressed.
+	for _, line := range []int{3, 4, 7, 8, 15} {
+		if !suppress[line] {
+			t.Errorf("line %d: want suppressed, got not suppressed", line)
+		}
+	}
+	// "for i := 0; i < n; i++ {" and "switch y := x[0]; y {" carry real
+	// init/cond/post/tag statements that DWARF can legitimately mark
+	// IsStmt, so their headers must not be blanket-suppressed.
+	for _, line := range []int{5, 9, 11, 12, 14, 16} {
+		if suppress[line] {
+			t.Errorf("line %d: want not suppressed, got suppressed", line)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	regressed := Line{"a.go", 1}   // IsStmt in base, not in new: a regression.
+	stillStmt := Line{"a.go", 2}   // IsStmt in both: unchanged, ignored.
+	stillNot := Line{"a.go", 3}    // not IsStmt in either: unchanged, ignored.
+	recoveredL := Line{"a.go", 4}  // not IsStmt in base, IsStmt in new: recovered.
+	goneNonStmt := Line{"a.go", 5} // not IsStmt in base, absent from new: ignored.
+	newStmt := Line{"b.go", 1}     // absent from base, IsStmt in new: counts as recovered.
+	newNonStmt := Line{"b.go", 2}  // absent from base, not IsStmt in new: ignored.
+
+	base := map[Line]bool{
+		regressed:   true,
+		stillStmt:   true,
+		stillNot:    false,
+		recoveredL:  false,
+		goneNonStmt: false,
+	}
+	next := map[Line]bool{
+		stillStmt:  true,
+		stillNot:   false,
+		recoveredL: true,
+		newStmt:    true,
+		newNonStmt: false,
+	}
+
+	regressions, recovered := diffLines(base, next)
+
+	if len(regressions) != 1 || regressions[0] != regressed {
+		t.Errorf("got regressions %v, want [%v]", regressions, regressed)
+	}
+	if recovered != 2 {
+		t.Errorf("got recovered=%d, want 2 (recoveredL + newStmt)", recovered)
+	}
+}
+
+func testHits() []Hit {
+	return []Hit{
+		{File: "a.go", Line: 3, Text: "for {", Package: "p"},
+		{File: "a.go", Line: 7, Text: "}", Package: "p"},
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	out := captureStdout(t, func() {
+		r := &jsonReporter{}
+		if err := r.Report(testHits(), Summary{Total: 2, Recovered: 3}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3 (2 hits + summary): %q", len(lines), out)
+	}
+	var h Hit
+	if err := json.Unmarshal([]byte(lines[0]), &h); err != nil {
+		t.Fatalf("decoding hit: %v", err)
+	}
+	if h.File != "a.go" || h.Line != 3 {
+		t.Errorf("got hit %+v", h)
+	}
+	var summary jsonSummary
+	if err := json.Unmarshal([]byte(lines[2]), &summary); err != nil {
+		t.Fatalf("decoding summary: %v", err)
+	}
+	if summary.Recovered != 3 {
+		t.Errorf("got recovered=%d, want 3", summary.Recovered)
+	}
+}
+
+func TestJSONReporterNoSummaryOutsideBaseline(t *testing.T) {
+	out := captureStdout(t, func() {
+		r := &jsonReporter{}
+		if err := r.Report(testHits(), Summary{Total: 2, Recovered: -1}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2 (hits only): %q", len(lines), out)
+	}
+}
+
+func TestSARIFReporter(t *testing.T) {
+	out := captureStdout(t, func() {
+		r := &sarifReporter{}
+		if err := r.Report(testHits(), Summary{Total: 2, Recovered: 1}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var log sarifLog
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatalf("sarif output isn't valid JSON: %v\n%s", err, out)
+	}
+	if len(log.Runs) != 1 || len(log.Runs[0].Results) != 2 {
+		t.Fatalf("got %+v", log)
+	}
+	if log.Runs[0].Properties == nil || log.Runs[0].Properties.Recovered != 1 {
+		t.Errorf("got properties %+v, want Recovered=1", log.Runs[0].Properties)
+	}
+	if log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI != "a.go" {
+		t.Errorf("got %+v", log.Runs[0].Results[0])
+	}
+}
+
+func TestCheckstyleReporter(t *testing.T) {
+	out := captureStdout(t, func() {
+		r := &checkstyleReporter{}
+		if err := r.Report(testHits(), Summary{Total: 2, Recovered: 4}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var root checkstyleRoot
+	if err := xml.Unmarshal([]byte(out), &root); err != nil {
+		t.Fatalf("checkstyle output isn't valid XML: %v\n%s", err, out)
+	}
+	if len(root.Files) != 1 || len(root.Files[0].Errors) != 2 {
+		t.Fatalf("got %+v", root)
+	}
+	if root.Recovered == nil || *root.Recovered != 4 {
+		t.Errorf("got recovered=%v, want 4", root.Recovered)
+	}
+}
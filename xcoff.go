@@ -0,0 +1,242 @@
+package main
+
+// Minimal XCOFF (AIX) object-file reader, just enough to extract the
+// sections debug/dwarf needs. internal/xcoff in the standard library
+// can't be imported from outside the standard library tree, so this is
+// a trimmed-down, vendored reimplementation: it reads the file and
+// section headers and hands back the named DWARF sections, but (unlike
+// internal/xcoff) never parses the symbol table, relocations, or loader
+// section, since DWARF() doesn't need them.
+//
+// Struct layouts and constants are taken from the XCOFF object file
+// format as documented by AIX and mirrored in internal/xcoff.
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	xcoffU802TOCMAGIC = 0737 // AIX 32-bit XCOFF
+	xcoffU64TOCMAGIC  = 0767 // AIX 64-bit XCOFF
+
+	xcoffFILHSZ32 = 20
+	xcoffFILHSZ64 = 24
+
+	xcoffSTYPDWARF = 0x0010
+
+	xcoffSSUBTYPDWINFO  = 0x10000 // DWARF info section
+	xcoffSSUBTYPDWLINE  = 0x20000 // DWARF line-number section
+	xcoffSSUBTYPDWABREV = 0x60000 // DWARF abbreviation section
+	xcoffSSUBTYPDWSTR   = 0x70000 // DWARF strings section
+	xcoffSSUBTYPDWRNGES = 0x80000 // DWARF ranges section
+
+	// maxXCOFFSectionSize bounds a single section read, so a corrupt
+	// section size field can't trigger a multi-gigabyte allocation.
+	maxXCOFFSectionSize = 1 << 30
+)
+
+type xcoffFileHeader32 struct {
+	Fmagic   uint16
+	Fnscns   uint16
+	Ftimedat uint32
+	Fsymptr  uint32
+	Fnsyms   uint32
+	Fopthdr  uint16
+	Fflags   uint16
+}
+
+type xcoffFileHeader64 struct {
+	Fmagic   uint16
+	Fnscns   uint16
+	Ftimedat uint32
+	Fsymptr  uint64
+	Fopthdr  uint16
+	Fflags   uint16
+	Fnsyms   uint32
+}
+
+type xcoffSectionHeader32 struct {
+	Sname    [8]byte
+	Spaddr   uint32
+	Svaddr   uint32
+	Ssize    uint32
+	Sscnptr  uint32
+	Srelptr  uint32
+	Slnnoptr uint32
+	Snreloc  uint16
+	Snlnno   uint16
+	Sflags   uint32
+}
+
+type xcoffSectionHeader64 struct {
+	Sname    [8]byte
+	Spaddr   uint64
+	Svaddr   uint64
+	Ssize    uint64
+	Sscnptr  uint64
+	Srelptr  uint64
+	Slnnoptr uint64
+	Snreloc  uint32
+	Snlnno   uint32
+	Sflags   uint32
+	Spad     uint32
+}
+
+type xcoffSection struct {
+	name   string
+	typ    uint32
+	scnptr int64
+	size   int64
+}
+
+func xcoffCString(b []byte) string {
+	i := 0
+	for i < len(b) && b[i] != 0 {
+		i++
+	}
+	return string(b[:i])
+}
+
+// xcoffOpen opens path as an XCOFF (AIX) object file and returns its
+// sections, enough to satisfy xcoffDWARF.
+func xcoffOpen(path string) (*os.File, []xcoffSection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sr := io.NewSectionReader(f, 0, 1<<63-1)
+
+	var magic uint16
+	if err := binary.Read(sr, binary.BigEndian, &magic); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if magic != xcoffU802TOCMAGIC && magic != xcoffU64TOCMAGIC {
+		f.Close()
+		return nil, nil, fmt.Errorf("unrecognised XCOFF magic: 0x%x", magic)
+	}
+
+	if _, err := sr.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	var nscns uint16
+	var opthdr uint16
+	var hdrsz int64
+	switch magic {
+	case xcoffU802TOCMAGIC:
+		var fhdr xcoffFileHeader32
+		if err := binary.Read(sr, binary.BigEndian, &fhdr); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		nscns, opthdr, hdrsz = fhdr.Fnscns, fhdr.Fopthdr, xcoffFILHSZ32
+	case xcoffU64TOCMAGIC:
+		var fhdr xcoffFileHeader64
+		if err := binary.Read(sr, binary.BigEndian, &fhdr); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		nscns, opthdr, hdrsz = fhdr.Fnscns, fhdr.Fopthdr, xcoffFILHSZ64
+	}
+
+	if _, err := sr.Seek(hdrsz+int64(opthdr), io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	sections := make([]xcoffSection, 0, nscns)
+	for i := 0; i < int(nscns); i++ {
+		var s xcoffSection
+		switch magic {
+		case xcoffU802TOCMAGIC:
+			var shdr xcoffSectionHeader32
+			if err := binary.Read(sr, binary.BigEndian, &shdr); err != nil {
+				f.Close()
+				return nil, nil, err
+			}
+			s = xcoffSection{
+				name:   xcoffCString(shdr.Sname[:]),
+				typ:    shdr.Sflags,
+				scnptr: int64(shdr.Sscnptr),
+				size:   int64(shdr.Ssize),
+			}
+		case xcoffU64TOCMAGIC:
+			var shdr xcoffSectionHeader64
+			if err := binary.Read(sr, binary.BigEndian, &shdr); err != nil {
+				f.Close()
+				return nil, nil, err
+			}
+			s = xcoffSection{
+				name:   xcoffCString(shdr.Sname[:]),
+				typ:    shdr.Sflags,
+				scnptr: int64(shdr.Sscnptr),
+				size:   int64(shdr.Ssize),
+			}
+		}
+		sections = append(sections, s)
+	}
+
+	return f, sections, nil
+}
+
+// xcoffSectionData reads the raw bytes of section s from f.
+func xcoffSectionData(f *os.File, s xcoffSection) ([]byte, error) {
+	if s.size > maxXCOFFSectionSize {
+		return nil, fmt.Errorf("xcoff: section %q too large (%d bytes)", s.name, s.size)
+	}
+	if s.scnptr == 0 {
+		// .bss and similarly uninitialized sections have no file content.
+		return make([]byte, s.size), nil
+	}
+	dat := make([]byte, s.size)
+	if _, err := f.ReadAt(dat, s.scnptr); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return dat, nil
+}
+
+// xcoffDWARF opens path as an XCOFF (AIX) object file and extracts the
+// DWARF data from it, mirroring internal/xcoff's File.DWARF.
+func xcoffDWARF(path string) (*dwarf.Data, error) {
+	f, sections, err := xcoffOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var abbrev, info, line, ranges, str []byte
+	for _, s := range sections {
+		if s.typ&xcoffSTYPDWARF == 0 {
+			continue
+		}
+		var dst *[]byte
+		switch s.typ &^ xcoffSTYPDWARF {
+		case xcoffSSUBTYPDWABREV:
+			dst = &abbrev
+		case xcoffSSUBTYPDWINFO:
+			dst = &info
+		case xcoffSSUBTYPDWLINE:
+			dst = &line
+		case xcoffSSUBTYPDWRNGES:
+			dst = &ranges
+		case xcoffSSUBTYPDWSTR:
+			dst = &str
+		default:
+			continue
+		}
+		dat, err := xcoffSectionData(f, s)
+		if err != nil {
+			return nil, err
+		}
+		*dst = dat
+	}
+
+	return dwarf.New(abbrev, nil, nil, info, line, nil, ranges, str)
+}